@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Filters holds the glob-based selection criteria applied to both the src
+// and dest trees before paths are enqueued for comparison, and to xattr
+// names before they're diffed.
+type Filters struct {
+	Include      []string
+	Exclude      []string
+	IncludeXattr []string
+	ExcludeXattr []string
+}
+
+// MatchPath reports whether relPath should be compared, given the
+// include/exclude globs. An empty Include list matches everything.
+func (f *Filters) MatchPath(relPath string) bool {
+	if len(f.Include) > 0 && !anyGlobMatchesPath(f.Include, relPath) {
+		return false
+	}
+	return !anyGlobMatchesPath(f.Exclude, relPath)
+}
+
+// PruneDir reports whether relPath - a directory - should be skipped along
+// with its whole subtree. Only Exclude globs prune a subtree; an Include
+// glob that doesn't match an intermediate directory's own name must not
+// stop the walk from reaching matching descendants, so Include is applied
+// to leaf paths only (via MatchPath).
+func (f *Filters) PruneDir(relPath string) bool {
+	return anyGlobMatchesPath(f.Exclude, relPath)
+}
+
+// MatchXattr reports whether the named xattr should be compared, given the
+// include-xattr/exclude-xattr globs. xattrdiff's own bookkeeping xattrs
+// (internalXattrPrefix) are always excluded, regardless of those globs.
+func (f *Filters) MatchXattr(name string) bool {
+	if strings.HasPrefix(name, internalXattrPrefix) {
+		return false
+	}
+	return matchGlobs(name, f.IncludeXattr, f.ExcludeXattr)
+}
+
+func matchGlobs(name string, include, exclude []string) bool {
+	if len(include) > 0 {
+		matched := false
+		for _, pattern := range include {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, pattern := range exclude {
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func anyGlobMatchesPath(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if globMatchesPath(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatchesPath reports whether pattern matches relPath, either against
+// the full relative path (doublestar semantics, so "**/" is needed to
+// cross directories) or, for a pattern with no path separator, against
+// relPath's basename - so a plain pattern like "*.o" or "node_modules"
+// matches at any depth, the common "skip build artifacts" case.
+func globMatchesPath(pattern, relPath string) bool {
+	if ok, _ := doublestar.Match(pattern, relPath); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := doublestar.Match(pattern, filepath.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterStats counts paths and xattrs skipped by Filters, so verbose mode
+// can report how much of the tree filtering is excluding.
+type FilterStats struct {
+	PathSkips  int64
+	XattrSkips int64
+}
+
+func (s *FilterStats) skipPath() {
+	atomic.AddInt64(&s.PathSkips, 1)
+}
+
+func (s *FilterStats) skipXattr() {
+	atomic.AddInt64(&s.XattrSkips, 1)
+}
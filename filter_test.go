@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestFiltersPruneDirIgnoresInclude(t *testing.T) {
+	f := &Filters{Include: []string{"*.txt"}}
+	if f.PruneDir("sub") {
+		t.Fatal("PruneDir should not prune a directory based on Include patterns")
+	}
+	if !f.MatchPath("sub/keep.txt") {
+		t.Fatal("expected sub/keep.txt to match *.txt via basename fallback")
+	}
+}
+
+func TestFiltersPruneDirHonorsExclude(t *testing.T) {
+	f := &Filters{Exclude: []string{"sub"}}
+	if !f.PruneDir("sub") {
+		t.Fatal("expected an Exclude glob matching the directory name to prune it")
+	}
+	if !f.PruneDir("other/sub") {
+		t.Fatal("expected basename fallback to prune a nested sub directory too")
+	}
+	if f.PruneDir("subordinate") {
+		t.Fatal("did not expect a partial name match to prune")
+	}
+}
+
+func TestFiltersMatchPathIncludeExclude(t *testing.T) {
+	f := &Filters{Include: []string{"*.txt"}, Exclude: []string{"secret.txt"}}
+	cases := map[string]bool{
+		"a.txt":          true,
+		"sub/b.txt":      true,
+		"a.go":           false,
+		"secret.txt":     false,
+		"sub/secret.txt": false,
+	}
+	for path, want := range cases {
+		if got := f.MatchPath(path); got != want {
+			t.Errorf("MatchPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestFiltersMatchPathFullPathGlob(t *testing.T) {
+	f := &Filters{Exclude: []string{"sub/*.txt"}}
+	if f.MatchPath("sub/keep.txt") {
+		t.Fatal("expected a full-path glob to exclude the nested file")
+	}
+	if !f.MatchPath("other/keep.txt") {
+		t.Fatal("expected a file outside sub/, which the glob doesn't reach, to still match")
+	}
+}
+
+func TestFiltersMatchXattrExcludesInternalPrefix(t *testing.T) {
+	f := &Filters{}
+	if f.MatchXattr(hashXattrName) {
+		t.Fatalf("expected %s to always be excluded from the diff", hashXattrName)
+	}
+	if !f.MatchXattr("user.tag") {
+		t.Fatal("expected an ordinary xattr to match with no include/exclude globs")
+	}
+}
+
+func TestFiltersMatchXattrIncludeExclude(t *testing.T) {
+	f := &Filters{IncludeXattr: []string{"user.*"}, ExcludeXattr: []string{"user.secret"}}
+	if !f.MatchXattr("user.tag") {
+		t.Fatal("expected user.tag to match the include glob")
+	}
+	if f.MatchXattr("user.secret") {
+		t.Fatal("expected user.secret to be excluded despite matching the include glob")
+	}
+	if f.MatchXattr("system.other") {
+		t.Fatal("expected system.other not to match the include glob")
+	}
+}
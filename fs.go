@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/xattr"
+)
+
+// FS abstracts directory walking and xattr access so scanDirectory isn't
+// hard-wired to the local filesystem. The default implementation, osFS,
+// walks a real directory tree with filepath.Walk and github.com/pkg/xattr;
+// tests (and future backends comparing against a tar, squashfs, or mounted
+// image) can supply their own.
+type FS interface {
+	Walk(root string, fn filepath.WalkFunc) error
+	ListXattr(path string, isSymlink bool) ([]string, error)
+	GetXattr(path, name string, isSymlink bool) ([]byte, error)
+}
+
+// osFS is the default FS backed by the local filesystem.
+type osFS struct{}
+
+func (osFS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+func (osFS) ListXattr(path string, isSymlink bool) ([]string, error) {
+	if isSymlink {
+		return xattr.LList(path)
+	}
+	return xattr.List(path)
+}
+
+func (osFS) GetXattr(path, name string, isSymlink bool) ([]byte, error) {
+	if isSymlink {
+		return xattr.LGet(path, name)
+	}
+	return xattr.Get(path, name)
+}
+
+// WalkOptions controls which entries scanDirectory visits.
+type WalkOptions struct {
+	// FollowSymlinks reads xattrs from a symlink's target instead of the
+	// symlink itself.
+	FollowSymlinks bool
+	// IncludeDirs includes directory entries, which on macOS/Linux can
+	// carry their own xattrs (Finder info, ACLs).
+	IncludeDirs bool
+	// Xdev skips entries on a different device than the root.
+	Xdev bool
+}
+
+// deviceOf returns the device ID backing path, for --xdev comparisons.
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pkg/xattr"
+)
+
+func TestOSFSGetXattrSymlinkVsTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := xattr.Set(target, "user.tag", []byte("target-value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := xattr.LSet(link, "trusted.tag", []byte("link-value")); err != nil {
+		t.Skipf("cannot set trusted.* xattrs on a symlink here: %v", err)
+	}
+
+	fs := osFS{}
+
+	// isSymlink=false follows the symlink and reads the target's xattrs.
+	val, err := fs.GetXattr(link, "user.tag", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "target-value" {
+		t.Fatalf("follow-symlink read = %q, want %q", val, "target-value")
+	}
+
+	// isSymlink=true reads the symlink's own xattrs, not the target's.
+	val, err = fs.GetXattr(link, "trusted.tag", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "link-value" {
+		t.Fatalf("symlink-own read = %q, want %q", val, "link-value")
+	}
+	if _, err := fs.GetXattr(link, "user.tag", true); err == nil {
+		t.Fatal("expected the symlink's own xattr list not to include the target's user.tag")
+	}
+}
+
+func TestOSFSListXattrSymlinkVsTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := xattr.Set(target, "user.tag", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := xattr.LSet(link, "trusted.tag", []byte("v")); err != nil {
+		t.Skipf("cannot set trusted.* xattrs on a symlink here: %v", err)
+	}
+
+	fs := osFS{}
+
+	names, err := fs.ListXattr(link, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(names, "user.tag") {
+		t.Fatalf("follow-symlink list = %v, want it to include user.tag", names)
+	}
+
+	names, err = fs.ListXattr(link, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contains(names, "user.tag") || !contains(names, "trusted.tag") {
+		t.Fatalf("symlink-own list = %v, want only trusted.tag", names)
+	}
+}
+
+func contains(names []string, name string) bool {
+	sort.Strings(names)
+	i := sort.SearchStrings(names, name)
+	return i < len(names) && names[i] == name
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/xattr"
+	"lukechampine.com/blake3"
+)
+
+// xattrdiff caches a file's content hash on the file itself, keyed to its
+// mtime, so that repeat runs (e.g. nightly backup verification) don't
+// rehash unchanged files.
+const (
+	hashXattrName     = "user.xattrdiff.hash"
+	hashTimeXattrName = "user.xattrdiff.hashtime"
+	// internalXattrPrefix marks xattrs that are xattrdiff's own bookkeeping
+	// rather than data on the compared files, so Filters always hides them
+	// from the diff - otherwise the cache xattrs would show up as
+	// differences manufactured by the tool itself (e.g. hashTimeXattrName
+	// after a copy that didn't preserve mtimes).
+	internalXattrPrefix = "user.xattrdiff."
+)
+
+// HashOptions controls the optional --hash content-drift correlation mode.
+type HashOptions struct {
+	// Algo is "sha256" or "blake3".
+	Algo string
+	// NoCache disables reading and writing the cached hash xattrs.
+	NoCache bool
+}
+
+// ContentHash returns a content digest for path, reading it from the
+// user.xattrdiff.hash/hashtime cache xattrs if they're present and still
+// match modTime, and recomputing (then caching, unless NoCache) otherwise.
+func ContentHash(path string, modTime time.Time, opts HashOptions) ([]byte, error) {
+	if !opts.NoCache {
+		if digest, ok := readCachedHash(path, modTime); ok {
+			return digest, nil
+		}
+	}
+
+	digest, err := hashFile(path, opts.Algo)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoCache {
+		writeCachedHash(path, modTime, digest)
+	}
+	return digest, nil
+}
+
+func readCachedHash(path string, modTime time.Time) ([]byte, bool) {
+	hashTimeRaw, err := xattr.Get(path, hashTimeXattrName)
+	if err != nil {
+		return nil, false
+	}
+	cachedTime, err := time.Parse(time.RFC3339Nano, string(hashTimeRaw))
+	if err != nil || !cachedTime.Equal(modTime) {
+		return nil, false
+	}
+	digest, err := xattr.Get(path, hashXattrName)
+	if err != nil {
+		return nil, false
+	}
+	return digest, true
+}
+
+func writeCachedHash(path string, modTime time.Time, digest []byte) {
+	if err := xattr.Set(path, hashXattrName, digest); err != nil {
+		notifyError(err)
+		return
+	}
+	if err := xattr.Set(path, hashTimeXattrName, []byte(modTime.Format(time.RFC3339Nano))); err != nil {
+		notifyError(err)
+	}
+}
+
+func hashFile(path, algo string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var h hash.Hash
+	if algo == "blake3" {
+		h = blake3.New(32, nil)
+	} else {
+		h = sha256.New()
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
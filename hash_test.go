@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+func writeTestFile(t *testing.T, content string) (string, time.Time) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, info.ModTime()
+}
+
+func TestContentHashCachesAcrossCalls(t *testing.T) {
+	path, modTime := writeTestFile(t, "hello")
+
+	digest1, err := ContentHash(path, modTime, HashOptions{Algo: "sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, ok := readCachedHash(path, modTime)
+	if !ok {
+		t.Fatal("expected a cached hash after the first ContentHash call")
+	}
+	if string(cached) != string(digest1) {
+		t.Fatalf("cached digest %x != computed digest %x", cached, digest1)
+	}
+
+	digest2, err := ContentHash(path, modTime, HashOptions{Algo: "sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(digest2) != string(digest1) {
+		t.Fatalf("second ContentHash call returned %x, want cached %x", digest2, digest1)
+	}
+}
+
+func TestContentHashCacheInvalidatedByModTime(t *testing.T) {
+	path, modTime := writeTestFile(t, "hello")
+
+	if _, err := ContentHash(path, modTime, HashOptions{Algo: "sha256"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := readCachedHash(path, modTime.Add(time.Second)); ok {
+		t.Fatal("expected a changed modTime to invalidate the cache")
+	}
+}
+
+func TestContentHashNoCacheSkipsCacheXattrs(t *testing.T) {
+	path, modTime := writeTestFile(t, "hello")
+
+	if _, err := ContentHash(path, modTime, HashOptions{Algo: "sha256", NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xattr.Get(path, hashXattrName); err == nil {
+		t.Fatal("expected no cache xattr to be written when NoCache is set")
+	}
+}
+
+func TestContentHashAlgoChoice(t *testing.T) {
+	path, modTime := writeTestFile(t, "hello")
+
+	sha, err := ContentHash(path, modTime, HashOptions{Algo: "sha256", NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blake, err := ContentHash(path, modTime, HashOptions{Algo: "blake3", NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sha) == string(blake) {
+		t.Fatal("expected sha256 and blake3 to produce different digests")
+	}
+}
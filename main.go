@@ -5,36 +5,66 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jessevdk/go-flags"
-	"github.com/pkg/xattr"
 )
 
 type Entry struct {
 	Path   string
 	Xattrs map[string][]byte
+	// IsDir records whether the entry is a directory, so writeManifest can
+	// preserve that across a manifest round-trip.
+	IsDir bool
+	// IsSymlink records whether Xattrs was read from the symlink itself
+	// (as opposed to its target), so a Syncer writing this entry's xattrs
+	// back onto dest uses the matching L* xattr call.
+	IsSymlink bool
+	// ContentHash is the content digest computed in --hash mode; nil
+	// otherwise, and for non-regular-file entries.
+	ContentHash []byte
 }
 
-/*
-	TODO
-	Set exit code if any mismatches or errors
-*/
-
 func main() {
 	var opts struct {
-		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Verbose        bool     `short:"v" long:"verbose" description:"Show verbose debug information"`
+		Format         string   `short:"f" long:"format" description:"Output format" default:"text" choice:"text" choice:"json" choice:"ndjson"`
+		Include        []string `long:"include" description:"Only compare paths matching this glob (repeatable)"`
+		Exclude        []string `long:"exclude" description:"Skip paths matching this glob (repeatable)"`
+		IncludeXattr   []string `long:"include-xattr" description:"Only compare xattrs matching this glob (repeatable)"`
+		ExcludeXattr   []string `long:"exclude-xattr" description:"Skip xattrs matching this glob (repeatable)"`
+		Apply          bool     `long:"apply" description:"Write src xattrs onto dest so it matches src, instead of only reporting"`
+		DryRun         bool     `long:"dry-run" description:"With --apply, show what would be changed without writing"`
+		Delete         bool     `long:"delete" description:"With --apply, remove dest xattrs that don't exist in src"`
+		Only           []string `long:"only" description:"With --apply, only sync xattrs matching this glob (repeatable)"`
+		FollowSymlinks bool     `long:"follow-symlinks" description:"Read xattrs from a symlink's target instead of the symlink itself"`
+		NoDirs         bool     `long:"no-dirs" description:"Don't compare directory entries themselves (by default they're included, since they can carry their own xattrs)"`
+		Xdev           bool     `long:"xdev" description:"Don't cross filesystem boundaries"`
+		Jobs           int      `short:"j" long:"jobs" description:"Number of workers reading xattrs per side" default:"0"`
+		Hash           string   `long:"hash" description:"Correlate xattr diffs with content drift using this hash algorithm" optional:"yes" optional-value:"sha256" choice:"sha256" choice:"blake3"`
+		NoHashCache    bool     `long:"no-hash-cache" description:"With --hash, don't read or write the cached user.xattrdiff.hash xattr"`
 	}
 	args, err := flags.Parse(&opts)
 	if err != nil {
 		notifyError(err)
-		os.Exit(1)
+		os.Exit(2)
+	}
+
+	if len(args) == 3 && args[0] == "snapshot" {
+		runSnapshot(args[1], args[2], opts.Jobs, WalkOptions{
+			FollowSymlinks: opts.FollowSymlinks,
+			IncludeDirs:    !opts.NoDirs,
+			Xdev:           opts.Xdev,
+		})
+		return
 	}
 
 	if len(args) < 2 {
-		notifyErrorString("must provide two directories to compare")
-		os.Exit(1)
+		notifyErrorString("must provide two directories (or manifests) to compare")
+		os.Exit(2)
 	}
 	srcDir := args[0]
 	destDir := args[1]
@@ -43,28 +73,75 @@ func main() {
 		fmt.Printf("comparing %s to %s\n", srcDir, destDir)
 	}
 
+	reporter, err := newReporter(opts.Format, os.Stdout, srcDir, destDir)
+	if err != nil {
+		notifyError(err)
+		os.Exit(2)
+	}
+
+	filters := &Filters{
+		Include:      opts.Include,
+		Exclude:      opts.Exclude,
+		IncludeXattr: opts.IncludeXattr,
+		ExcludeXattr: opts.ExcludeXattr,
+	}
+	filterStats := &FilterStats{}
+
+	var syncer *Syncer
+	if opts.Apply {
+		syncer = &Syncer{DryRun: opts.DryRun, Delete: opts.Delete, Only: opts.Only}
+	}
+
+	srcFS, err := resolveFS(srcDir)
+	if err != nil {
+		notifyError(err)
+		os.Exit(2)
+	}
+	destFS, err := resolveFS(destDir)
+	if err != nil {
+		notifyError(err)
+		os.Exit(2)
+	}
+
+	walkOpts := WalkOptions{
+		FollowSymlinks: opts.FollowSymlinks,
+		IncludeDirs:    !opts.NoDirs,
+		Xdev:           opts.Xdev,
+	}
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	var hashOpts *HashOptions
+	if opts.Hash != "" {
+		hashOpts = &HashOptions{Algo: opts.Hash, NoCache: opts.NoHashCache}
+	}
+
 	chanBufferSize := 1000
 	srcChan := make(chan *Entry, chanBufferSize)
 	destChan := make(chan *Entry, chanBufferSize)
 
+	var scanErrors int64
+
 	var wg sync.WaitGroup
 	wg.Add(3)
 
 	var srcError error
 	go func() {
-		srcError = scanDirectory(srcDir, srcChan)
+		srcError = scanDirectory(srcFS, srcDir, srcChan, &scanErrors, filters, filterStats, walkOpts, jobs, hashOpts)
 		wg.Done()
 	}()
 
 	var destError error
 	go func() {
-		destError = scanDirectory(destDir, destChan)
+		destError = scanDirectory(destFS, destDir, destChan, &scanErrors, filters, filterStats, walkOpts, jobs, hashOpts)
 		wg.Done()
 	}()
 
 	var compareError error
 	go func() {
-		compareError = compareEntries(srcChan, destChan, srcDir, destDir, opts.Verbose)
+		compareError = compareEntries(srcChan, destChan, srcDir, destDir, opts.Verbose, reporter, filters, filterStats, syncer)
 		wg.Done()
 	}()
 
@@ -79,54 +156,81 @@ func main() {
 	if compareError != nil {
 		notifyError(compareError)
 	}
+
+	counts := reporter.Summary()
+
+	os.Exit(exitCode(srcError, destError, compareError, atomic.LoadInt64(&scanErrors), counts))
 }
 
-func notifyError(err error) {
-	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+// exitCode follows diff(1) conventions: 0 means the trees are identical,
+// 1 means differences were found, 2 means an error prevented a full
+// comparison.
+func exitCode(srcError, destError, compareError error, scanErrors int64, counts map[string]int) int {
+	if srcError != nil || destError != nil || compareError != nil || scanErrors > 0 {
+		return 2
+	}
+	for kind, n := range counts {
+		if kind != KindSummary && n > 0 {
+			return 1
+		}
+	}
+	return 0
 }
 
-func notifyErrorString(err string) {
-	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+// resolveFS picks the FS backend for a CLI argument: a manifest written by
+// "xattrdiff snapshot" if path looks like one, otherwise the real
+// filesystem.
+func resolveFS(path string) (FS, error) {
+	if isManifestFile(path) {
+		return loadManifestFS(path)
+	}
+	return osFS{}, nil
 }
 
-func scanDirectory(dir string, entries chan<- *Entry) error {
-	walkErr := filepath.Walk(dir, func(entryPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			notifyError(err)
-			return nil
-		}
+// runSnapshot implements "xattrdiff snapshot <dir> <manifest>": it scans
+// dir like a normal comparison side and writes the result to manifestPath
+// instead of comparing it against anything.
+func runSnapshot(dir, manifestPath string, jobs int, walkOpts WalkOptions) {
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
 
-		if !info.Mode().IsRegular() {
-			return nil
-		}
+	out, err := os.Create(manifestPath)
+	if err != nil {
+		notifyError(err)
+		os.Exit(2)
+	}
+	defer out.Close()
 
-		xattrs := make(map[string][]byte)
-		xattrNames, err := xattr.List(entryPath)
-		if err != nil {
-			notifyError(err)
-		} else {
-			for _, name := range xattrNames {
-				data, err := xattr.Get(entryPath, name)
-				if err != nil {
-					notifyError(err)
-				}
-				xattrs[name] = data
-			}
-		}
+	entries := make(chan *Entry, 1000)
+	var scanErrors int64
+	done := make(chan error, 1)
+	go func() {
+		done <- scanDirectory(osFS{}, dir, entries, &scanErrors, &Filters{}, &FilterStats{}, walkOpts, jobs, nil)
+	}()
 
-		entries <- &Entry{
-			Path:   entryPath,
-			Xattrs: xattrs,
-		}
+	if err := writeManifest(out, dir, entries, time.Now()); err != nil {
+		notifyError(err)
+		os.Exit(2)
+	}
+	if scanErr := <-done; scanErr != nil {
+		notifyError(scanErr)
+		os.Exit(2)
+	}
+	if scanErrors > 0 {
+		os.Exit(2)
+	}
+}
 
-		return nil
-	})
+func notifyError(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+}
 
-	close(entries)
-	return walkErr
+func notifyErrorString(err string) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
 }
 
-func compareEntries(src, dest <-chan *Entry, srcDir, destDir string, verbose bool) error {
+func compareEntries(src, dest <-chan *Entry, srcDir, destDir string, verbose bool, reporter Reporter, filters *Filters, filterStats *FilterStats, syncer *Syncer) error {
 	waitingForSrc := true
 	waitingForDest := true
 	srcComplete := false
@@ -167,18 +271,26 @@ func compareEntries(src, dest <-chan *Entry, srcDir, destDir string, verbose boo
 			}
 			if srcComplete {
 				// all remaining dest entries are missing in src
-				printOnlyIn(destDir, destEntry.Path)
+				destRelPath, err := filepath.Rel(destDir, destEntry.Path)
+				if err != nil {
+					return err
+				}
+				reporter.OnlyIn(SideDest, destRelPath)
 				destCount++
 				waitingForDest = true
 			} else if destComplete {
 				// all remaining src entries are missing in dest
-				printOnlyIn(srcDir, srcEntry.Path)
+				srcRelPath, err := filepath.Rel(srcDir, srcEntry.Path)
+				if err != nil {
+					return err
+				}
+				reporter.OnlyIn(SideSrc, srcRelPath)
 				srcCount++
 				waitingForSrc = true
 			} else {
 				// comparison - use relative paths because root dir doesn't matter
 				if verbose && time.Since(lastStatusUpdate).Seconds() > 5 {
-					fmt.Fprintf(os.Stderr, "src: %d processed, %d/%d queued, dest: %d processed, %d/%d queued\n", srcCount, len(src), cap(src), destCount, len(dest), cap(dest))
+					fmt.Fprintf(os.Stderr, "src: %d processed, %d/%d queued, dest: %d processed, %d/%d queued, %d paths skipped, %d xattrs skipped\n", srcCount, len(src), cap(src), destCount, len(dest), cap(dest), atomic.LoadInt64(&filterStats.PathSkips), atomic.LoadInt64(&filterStats.XattrSkips))
 					lastStatusUpdate = time.Now()
 				}
 				srcPath, err := filepath.Rel(srcDir, srcEntry.Path)
@@ -190,16 +302,19 @@ func compareEntries(src, dest <-chan *Entry, srcDir, destDir string, verbose boo
 					return err
 				}
 				if srcPath < destPath {
-					printOnlyIn(srcDir, srcEntry.Path)
+					reporter.OnlyIn(SideSrc, srcPath)
 					srcCount++
 					waitingForSrc = true
 				} else if srcPath > destPath {
-					printOnlyIn(destDir, destEntry.Path)
+					reporter.OnlyIn(SideDest, destPath)
 					destCount++
 					waitingForDest = true
 				} else {
 					// paths are equal, let's compare xattrs!
-					compareXattrs(srcEntry, destEntry, srcPath, destPath)
+					compareXattrs(srcEntry, destEntry, srcPath, reporter, filters, filterStats, syncer)
+					if srcEntry.ContentHash != nil && destEntry.ContentHash != nil && !bytes.Equal(srcEntry.ContentHash, destEntry.ContentHash) {
+						reporter.ContentMismatch(srcPath)
+					}
 					srcCount++
 					destCount++
 					waitingForSrc = true
@@ -211,43 +326,44 @@ func compareEntries(src, dest <-chan *Entry, srcDir, destDir string, verbose boo
 	return nil
 }
 
-func printOnlyIn(dir, path string) {
-	relPath, err := filepath.Rel(dir, path)
-	if err != nil {
-		relPath = path
-	}
-	fmt.Printf("only in %s: %s\n", dir, relPath)
-}
-
-func compareXattrs(srcEntry, destEntry *Entry, srcRelPath, destRelPath string) {
+func compareXattrs(srcEntry, destEntry *Entry, relPath string, reporter Reporter, filters *Filters, filterStats *FilterStats, syncer *Syncer) {
 	// copy for safe modification
 	destXattrs := make(map[string][]byte)
 	for key, val := range destEntry.Xattrs {
+		if !filters.MatchXattr(key) {
+			filterStats.skipXattr()
+			continue
+		}
 		destXattrs[key] = val
 	}
 
 	for key, val := range srcEntry.Xattrs {
+		if !filters.MatchXattr(key) {
+			filterStats.skipXattr()
+			continue
+		}
 		destVal, ok := destXattrs[key]
 		if ok {
 			if !bytes.Equal(val, destVal) {
-				printXattrMismatch(srcRelPath, destRelPath, key)
+				reporter.XattrMismatch(relPath, key, val, destVal)
+				if syncer != nil {
+					syncer.SetXattr(destEntry.Path, relPath, key, val, destEntry.IsSymlink, reporter)
+				}
 			}
 			delete(destXattrs, key)
 		} else {
-			printXattrOnlyIn(srcEntry.Path, key)
+			reporter.XattrOnlyIn(SideSrc, relPath, key, val)
+			if syncer != nil {
+				syncer.SetXattr(destEntry.Path, relPath, key, val, destEntry.IsSymlink, reporter)
+			}
 		}
 	}
 
 	// iterate on remaining xattrs which must only exist in dest
-	for key, _ := range destXattrs {
-		printXattrOnlyIn(destEntry.Path, key)
+	for key, val := range destXattrs {
+		reporter.XattrOnlyIn(SideDest, relPath, key, val)
+		if syncer != nil {
+			syncer.RemoveXattr(destEntry.Path, relPath, key, destEntry.IsSymlink, reporter)
+		}
 	}
 }
-
-func printXattrOnlyIn(path, name string) {
-	fmt.Printf("xattr only in %s: %s\n", path, name)
-}
-
-func printXattrMismatch(srcPath, destPath, name string) {
-	fmt.Printf("%s %s differ: %s\n", srcPath, destPath, name)
-}
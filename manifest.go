@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestMagic marks the first line of a manifest file, both to identify
+// the format and to let xattrdiff tell a manifest apart from a directory
+// when given as a CLI argument.
+const manifestMagic = "# xattrdiff-manifest v1"
+
+// dirMarkerXattr flags a manifest line as recording that relpath is a
+// directory rather than a regular file. It's safe as a sentinel because
+// "/" can never appear in a real xattr name.
+const dirMarkerXattr = "/"
+
+// writeManifest serializes entries (already sorted by relative path, as
+// scanDirectory produces them) as a stable, line-oriented manifest: a
+// header recording the root, hostname, and creation time, followed by one
+// tab-separated (relpath, xattr name, base64 value) line per xattr. Paths
+// with no xattrs still get one line, with empty name/value fields, so a
+// later diff can tell the path existed. Directories additionally get a
+// dirMarkerXattr line, so loadManifestFS can tell them apart from files
+// (needed for --no-dirs to filter manifest-backed entries the same way
+// it does real ones).
+func writeManifest(w io.Writer, root string, entries <-chan *Entry, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	hostname, _ := os.Hostname()
+	fmt.Fprintf(bw, "%s\n", manifestMagic)
+	fmt.Fprintf(bw, "# root: %s\n", root)
+	fmt.Fprintf(bw, "# host: %s\n", hostname)
+	fmt.Fprintf(bw, "# created: %s\n", now.Format(time.RFC3339Nano))
+
+	for entry := range entries {
+		relPath, err := filepath.Rel(root, entry.Path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir {
+			fmt.Fprintf(bw, "%s\t%s\t\n", relPath, dirMarkerXattr)
+		}
+		if len(entry.Xattrs) == 0 {
+			if !entry.IsDir {
+				fmt.Fprintf(bw, "%s\t\t\n", relPath)
+			}
+			continue
+		}
+		names := make([]string, 0, len(entry.Xattrs))
+		for name := range entry.Xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s\t%s\t%s\n", relPath, name, base64.StdEncoding.EncodeToString(entry.Xattrs[name]))
+		}
+	}
+	return bw.Flush()
+}
+
+// manifestFS is an FS backed by a manifest file captured by writeManifest,
+// letting a live tree be diffed against a known-good baseline - or two
+// baselines against each other - without needing both trees online at
+// once.
+type manifestFS struct {
+	root    string
+	order   []string
+	entries map[string]map[string][]byte
+	dirs    map[string]bool
+}
+
+// isManifestFile reports whether path looks like a manifest written by
+// writeManifest, as opposed to a directory to walk live.
+func isManifestFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	return err == nil && strings.TrimRight(line, "\n") == manifestMagic
+}
+
+func loadManifestFS(root string) (*manifestFS, error) {
+	f, err := os.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &manifestFS{root: root, entries: map[string]map[string][]byte{}, dirs: map[string]bool{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("manifest %s: malformed line %q", root, line)
+		}
+		relPath, name, encoded := fields[0], fields[1], fields[2]
+		if _, ok := m.entries[relPath]; !ok {
+			m.entries[relPath] = map[string][]byte{}
+			m.order = append(m.order, relPath)
+		}
+		if name == dirMarkerXattr {
+			m.dirs[relPath] = true
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %s: %s: %w", root, relPath, name, err)
+		}
+		m.entries[relPath][name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(m.order)
+	return m, nil
+}
+
+// Walk replays the manifest's entries in sorted order, honoring the same
+// filepath.SkipDir contract as filepath.Walk: when fn returns SkipDir for a
+// directory, every entry nested under it (identified by relpath prefix,
+// since m.order is already sorted) is skipped too, not just that one line.
+func (m *manifestFS) Walk(root string, fn filepath.WalkFunc) error {
+	var skipPrefix string
+	for _, relPath := range m.order {
+		if skipPrefix != "" && strings.HasPrefix(relPath, skipPrefix) {
+			continue
+		}
+		skipPrefix = ""
+
+		info := manifestFileInfo{name: filepath.Base(relPath), isDir: m.dirs[relPath]}
+		err := fn(filepath.Join(root, relPath), info, nil)
+		if err == filepath.SkipDir {
+			skipPrefix = relPath + "/"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *manifestFS) relPath(path string) string {
+	relPath, err := filepath.Rel(m.root, path)
+	if err != nil {
+		return path
+	}
+	return relPath
+}
+
+func (m *manifestFS) ListXattr(path string, isSymlink bool) ([]string, error) {
+	xattrs, ok := m.entries[m.relPath(path)]
+	if !ok {
+		return nil, fmt.Errorf("manifest %s: no such path: %s", m.root, m.relPath(path))
+	}
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *manifestFS) GetXattr(path, name string, isSymlink bool) ([]byte, error) {
+	xattrs, ok := m.entries[m.relPath(path)]
+	if !ok {
+		return nil, fmt.Errorf("manifest %s: no such path: %s", m.root, m.relPath(path))
+	}
+	value, ok := xattrs[name]
+	if !ok {
+		return nil, fmt.Errorf("manifest %s: %s: no such xattr: %s", m.root, m.relPath(path), name)
+	}
+	return value, nil
+}
+
+// manifestFileInfo is a minimal os.FileInfo for manifest entries. Besides
+// name and directory-ness (from the dirMarkerXattr line), manifest entries
+// carry no real file metadata.
+type manifestFileInfo struct {
+	name  string
+	isDir bool
+}
+
+func (n manifestFileInfo) Name() string { return n.name }
+func (n manifestFileInfo) Size() int64  { return 0 }
+func (n manifestFileInfo) Mode() os.FileMode {
+	if n.isDir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+func (n manifestFileInfo) ModTime() time.Time { return time.Time{} }
+func (n manifestFileInfo) IsDir() bool        { return n.isDir }
+func (n manifestFileInfo) Sys() interface{}   { return nil }
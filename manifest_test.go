@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func buildTestManifest(t *testing.T, root string, entries []*Entry) string {
+	t.Helper()
+	ch := make(chan *Entry, len(entries))
+	for _, e := range entries {
+		ch <- e
+	}
+	close(ch)
+
+	var buf bytes.Buffer
+	if err := writeManifest(&buf, root, ch, time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.manifest")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWriteManifestRoundTrip(t *testing.T) {
+	root := "/srv/data"
+	manifestPath := buildTestManifest(t, root, []*Entry{
+		{Path: filepath.Join(root, "."), IsDir: true},
+		{Path: filepath.Join(root, "a.txt"), Xattrs: map[string][]byte{"user.tag": []byte("v1")}},
+		{Path: filepath.Join(root, "empty.txt")},
+		{Path: filepath.Join(root, "sub"), IsDir: true, Xattrs: map[string][]byte{"user.dirtag": []byte("dv")}},
+	})
+
+	if !isManifestFile(manifestPath) {
+		t.Fatal("expected isManifestFile to recognize the written manifest")
+	}
+
+	m, err := loadManifestFS(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Walk/ListXattr/GetXattr are always driven with the manifest's own
+	// path as the "root" argument in production (scanDirectory walks
+	// whatever CLI arg it was given, which for a manifest side is the
+	// manifest file itself), not the directory the manifest was captured
+	// from - so relative paths here are computed against manifestPath.
+	var seen []string
+	err = m.Walk(manifestPath, func(path string, info os.FileInfo, err error) error {
+		seen = append(seen, info.Name())
+		switch info.Name() {
+		case ".", "sub":
+			if !info.IsDir() {
+				t.Errorf("expected %q to be a directory", path)
+			}
+		case "a.txt", "empty.txt":
+			if info.IsDir() {
+				t.Errorf("expected %q not to be a directory", path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 4 {
+		t.Fatalf("walked %v, want 4 entries", seen)
+	}
+
+	subXattrs, err := m.ListXattr(filepath.Join(manifestPath, "sub"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(subXattrs)
+	if len(subXattrs) != 1 || subXattrs[0] != "user.dirtag" {
+		t.Fatalf("sub xattrs = %v, want [user.dirtag]", subXattrs)
+	}
+	val, err := m.GetXattr(filepath.Join(manifestPath, "sub"), "user.dirtag", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "dv" {
+		t.Fatalf("sub user.dirtag = %q, want %q", val, "dv")
+	}
+
+	val, err = m.GetXattr(filepath.Join(manifestPath, "a.txt"), "user.tag", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v1" {
+		t.Fatalf("a.txt user.tag = %q, want %q", val, "v1")
+	}
+
+	emptyXattrs, err := m.ListXattr(filepath.Join(manifestPath, "empty.txt"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emptyXattrs) != 0 {
+		t.Fatalf("empty.txt xattrs = %v, want none", emptyXattrs)
+	}
+}
+
+func TestManifestFSWalkSkipDir(t *testing.T) {
+	root := "/srv/data"
+	manifestPath := buildTestManifest(t, root, []*Entry{
+		{Path: filepath.Join(root, "a.txt")},
+		{Path: filepath.Join(root, "sub"), IsDir: true},
+		{Path: filepath.Join(root, "sub/b.txt")},
+		{Path: filepath.Join(root, "sub/c.txt")},
+		{Path: filepath.Join(root, "zzz.txt")},
+	})
+
+	m, err := loadManifestFS(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	err = m.Walk(root, func(path string, info os.FileInfo, err error) error {
+		visited = append(visited, info.Name())
+		if info.Name() == "sub" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.txt", "sub", "zzz.txt"}
+	if len(visited) != len(want) {
+		t.Fatalf("visited %v, want %v", visited, want)
+	}
+	for i := range want {
+		if visited[i] != want[i] {
+			t.Fatalf("visited %v, want %v", visited, want)
+		}
+	}
+}
+
+func TestLoadManifestFSMalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.manifest")
+	content := manifestMagic + "\n# root: /srv/data\na.txt\tonlyonefield\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifestFS(path); err == nil {
+		t.Fatal("expected an error for a malformed manifest line")
+	}
+}
+
+func TestLoadManifestFSBadBase64(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.manifest")
+	content := manifestMagic + "\n# root: /srv/data\na.txt\tuser.tag\tnot-valid-base64!!\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifestFS(path); err == nil {
+		t.Fatal("expected an error for malformed base64")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scanTask is a path discovered by the walk, queued for a worker to read
+// its xattrs.
+type scanTask struct {
+	path          string
+	relPath       string
+	readAsSymlink bool
+	isRegular     bool
+	isDir         bool
+	modTime       time.Time
+}
+
+// scannedEntry pairs a produced Entry with the relative path used to order
+// it, so workers don't need to recompute filepath.Rel when sorting.
+type scannedEntry struct {
+	entry   *Entry
+	relPath string
+}
+
+// scanDirectory walks dir and reads xattrs for every matched entry. The
+// walk itself only discovers paths; jobs workers read xattrs in parallel,
+// since on network filesystems or FUSE mounts xattr.List/Get latency -
+// not the walk - dominates. compareEntries depends on entries arriving in
+// sorted relative-path order, so results are buffered and sorted here
+// before being sent on, rather than streamed as workers finish.
+func scanDirectory(fs FS, dir string, entries chan<- *Entry, errorCount *int64, filters *Filters, filterStats *FilterStats, opts WalkOptions, jobs int, hashOpts *HashOptions) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	tasks := make(chan scanTask, jobs*4)
+	results := make(chan scannedEntry, jobs*4)
+
+	var rootDev uint64
+	var haveRootDev bool
+	var walkErr error
+	go func() {
+		defer close(tasks)
+		walkErr = fs.Walk(dir, func(entryPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				notifyError(err)
+				atomic.AddInt64(errorCount, 1)
+				return nil
+			}
+
+			if entryPath == dir {
+				rootDev, haveRootDev = deviceOf(info)
+			}
+
+			isSymlink := info.Mode()&os.ModeSymlink != 0
+			isDir := info.IsDir()
+			if !info.Mode().IsRegular() && !isSymlink && !isDir {
+				// skip devices, sockets, and other special files
+				return nil
+			}
+			if isDir && !opts.IncludeDirs {
+				return nil
+			}
+
+			if opts.Xdev && haveRootDev {
+				if dev, ok := deviceOf(info); ok && dev != rootDev {
+					if isDir {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+
+			relPath, err := filepath.Rel(dir, entryPath)
+			if err != nil {
+				notifyError(err)
+				atomic.AddInt64(errorCount, 1)
+				return nil
+			}
+			if isDir && filters.PruneDir(relPath) {
+				filterStats.skipPath()
+				return filepath.SkipDir
+			}
+			if !filters.MatchPath(relPath) {
+				filterStats.skipPath()
+				return nil
+			}
+
+			tasks <- scanTask{
+				path:          entryPath,
+				relPath:       relPath,
+				readAsSymlink: isSymlink && !opts.FollowSymlinks,
+				isRegular:     info.Mode().IsRegular(),
+				isDir:         isDir,
+				modTime:       info.ModTime(),
+			}
+			return nil
+		})
+	}()
+
+	var workers sync.WaitGroup
+	workers.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer workers.Done()
+			for task := range tasks {
+				results <- scannedEntry{entry: readXattrs(fs, task, errorCount, hashOpts), relPath: task.relPath}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	buffered := make([]scannedEntry, 0, jobs*4)
+	for result := range results {
+		buffered = append(buffered, result)
+	}
+
+	sort.Slice(buffered, func(i, j int) bool {
+		return buffered[i].relPath < buffered[j].relPath
+	})
+	for _, result := range buffered {
+		entries <- result.entry
+	}
+
+	close(entries)
+	return walkErr
+}
+
+// readXattrs reads every xattr for a single scanTask, run by a scanDirectory
+// worker.
+func readXattrs(fs FS, task scanTask, errorCount *int64, hashOpts *HashOptions) *Entry {
+	xattrs := make(map[string][]byte)
+	xattrNames, err := fs.ListXattr(task.path, task.readAsSymlink)
+	if err != nil {
+		notifyError(err)
+		atomic.AddInt64(errorCount, 1)
+	} else {
+		for _, name := range xattrNames {
+			data, err := fs.GetXattr(task.path, name, task.readAsSymlink)
+			if err != nil {
+				notifyError(err)
+				atomic.AddInt64(errorCount, 1)
+			}
+			xattrs[name] = data
+		}
+	}
+
+	entry := &Entry{
+		Path:      task.path,
+		Xattrs:    xattrs,
+		IsDir:     task.isDir,
+		IsSymlink: task.readAsSymlink,
+	}
+
+	// ContentHash reads the file directly off disk, so it only makes sense
+	// against the real filesystem - a manifest records xattrs, not content.
+	if _, isOS := fs.(osFS); isOS && hashOpts != nil && task.isRegular {
+		digest, err := ContentHash(task.path, task.modTime, *hashOpts)
+		if err != nil {
+			notifyError(err)
+			atomic.AddInt64(errorCount, 1)
+		} else {
+			entry.ContentHash = digest
+		}
+	}
+
+	return entry
+}
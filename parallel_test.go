@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// latentMemFS is a synthetic FS of regular files under a single directory,
+// used to benchmark scanDirectory without touching a real disk. Each xattr
+// read sleeps briefly to stand in for the latency of a network filesystem
+// or FUSE mount, where scanDirectory's worker pool is meant to help.
+type latentMemFS struct {
+	root    string
+	files   []string
+	latency time.Duration
+}
+
+func newLatentMemFS(root string, count int, latency time.Duration) *latentMemFS {
+	files := make([]string, count)
+	for i := range files {
+		files[i] = filepath.Join(root, fmt.Sprintf("file-%06d", i))
+	}
+	return &latentMemFS{root: root, files: files, latency: latency}
+}
+
+func (fs *latentMemFS) Walk(root string, fn filepath.WalkFunc) error {
+	if err := fn(root, fakeDirInfo(filepath.Base(root)), nil); err != nil {
+		return err
+	}
+	for _, path := range fs.files {
+		if err := fn(path, fakeFileInfo(filepath.Base(path)), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *latentMemFS) ListXattr(path string, isSymlink bool) ([]string, error) {
+	time.Sleep(fs.latency)
+	if path == fs.root {
+		return nil, nil
+	}
+	return []string{"user.xattrdiff.bench"}, nil
+}
+
+func (fs *latentMemFS) GetXattr(path, name string, isSymlink bool) ([]byte, error) {
+	time.Sleep(fs.latency)
+	return []byte(path), nil
+}
+
+type fakeFileInfo string
+
+func (n fakeFileInfo) Name() string       { return string(n) }
+func (n fakeFileInfo) Size() int64        { return 0 }
+func (n fakeFileInfo) Mode() os.FileMode  { return 0o644 }
+func (n fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (n fakeFileInfo) IsDir() bool        { return false }
+func (n fakeFileInfo) Sys() interface{}   { return nil }
+
+type fakeDirInfo string
+
+func (n fakeDirInfo) Name() string       { return string(n) }
+func (n fakeDirInfo) Size() int64        { return 0 }
+func (n fakeDirInfo) Mode() os.FileMode  { return os.ModeDir | 0o755 }
+func (n fakeDirInfo) ModTime() time.Time { return time.Time{} }
+func (n fakeDirInfo) IsDir() bool        { return true }
+func (n fakeDirInfo) Sys() interface{}   { return nil }
+
+func runScan(b *testing.B, jobs int) {
+	fs := newLatentMemFS("/synthetic", 100000, 50*time.Microsecond)
+	entries := make(chan *Entry, 1000)
+	var errorCount int64
+	filters := &Filters{}
+	filterStats := &FilterStats{}
+	opts := WalkOptions{IncludeDirs: true}
+
+	go func() {
+		for range entries {
+		}
+	}()
+	if err := scanDirectory(fs, fs.root, entries, &errorCount, filters, filterStats, opts, jobs, nil); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkScanDirectorySequential(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		runScan(b, 1)
+	}
+}
+
+func BenchmarkScanDirectoryParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		runScan(b, 8)
+	}
+}
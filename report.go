@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Side identifies which of the two compared trees an entry belongs to.
+type Side string
+
+const (
+	SideSrc  Side = "src"
+	SideDest Side = "dest"
+)
+
+// Record kinds, used as the "kind" field in JSON/NDJSON output.
+const (
+	KindOnlyInSrc       = "only_in_src"
+	KindOnlyInDest      = "only_in_dest"
+	KindXattrOnlySrc    = "xattr_only_in_src"
+	KindXattrOnlyDest   = "xattr_only_in_dest"
+	KindXattrMismatch   = "xattr_mismatch"
+	KindContentMismatch = "content_mismatch"
+	KindSyncSet         = "sync_set"
+	KindSyncRemove      = "sync_remove"
+	KindSummary         = "summary"
+)
+
+// Record is a single structured diff result emitted in json/ndjson format.
+type Record struct {
+	Kind      string         `json:"kind"`
+	Path      string         `json:"path,omitempty"`
+	Attr      string         `json:"attr,omitempty"`
+	SrcValue  string         `json:"src_value,omitempty"`
+	DestValue string         `json:"dest_value,omitempty"`
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Counts    map[string]int `json:"counts,omitempty"`
+}
+
+// Reporter receives diff results as they're found and is responsible for
+// presenting them in whatever output format was requested. Implementations
+// are only ever driven from the single compareEntries goroutine, so they
+// don't need to be safe for concurrent use.
+type Reporter interface {
+	OnlyIn(side Side, relPath string)
+	XattrOnlyIn(side Side, relPath, attr string, value []byte)
+	XattrMismatch(relPath, attr string, srcValue, destValue []byte)
+	// ContentMismatch reports that a matched path's content differs, as
+	// determined by --hash. It's independent of whether xattrs also
+	// differ for the same path, letting callers correlate the two.
+	ContentMismatch(relPath string)
+	// SyncSet reports that a src xattr was (or, if dryRun, would be) written
+	// onto dest by --apply.
+	SyncSet(relPath, attr string, dryRun bool)
+	// SyncRemove reports that a dest-only xattr was (or, if dryRun, would be)
+	// removed by --apply --delete.
+	SyncRemove(relPath, attr string, dryRun bool)
+	// Summary finalizes output and returns counts per kind, used to decide
+	// the process exit code.
+	Summary() map[string]int
+}
+
+func newReporter(format string, out io.Writer, srcDir, destDir string) (Reporter, error) {
+	switch format {
+	case "", "text":
+		return &textReporter{out: out, srcDir: srcDir, destDir: destDir, counts: map[string]int{}}, nil
+	case "json":
+		return &jsonReporter{out: out, counts: map[string]int{}}, nil
+	case "ndjson":
+		return &ndjsonReporter{w: bufio.NewWriter(out), counts: map[string]int{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// textReporter reproduces xattrdiff's original human-readable output.
+type textReporter struct {
+	out             io.Writer
+	srcDir, destDir string
+	counts          map[string]int
+}
+
+func (r *textReporter) dirFor(side Side) string {
+	if side == SideSrc {
+		return r.srcDir
+	}
+	return r.destDir
+}
+
+func (r *textReporter) OnlyIn(side Side, relPath string) {
+	kind := KindOnlyInDest
+	if side == SideSrc {
+		kind = KindOnlyInSrc
+	}
+	r.counts[kind]++
+	fmt.Fprintf(r.out, "only in %s: %s\n", r.dirFor(side), relPath)
+}
+
+func (r *textReporter) XattrOnlyIn(side Side, relPath, attr string, value []byte) {
+	kind := KindXattrOnlyDest
+	if side == SideSrc {
+		kind = KindXattrOnlySrc
+	}
+	r.counts[kind]++
+	fmt.Fprintf(r.out, "xattr only in %s: %s: %s\n", r.dirFor(side), relPath, attr)
+}
+
+func (r *textReporter) XattrMismatch(relPath, attr string, srcValue, destValue []byte) {
+	r.counts[KindXattrMismatch]++
+	fmt.Fprintf(r.out, "%s differ: %s\n", relPath, attr)
+}
+
+func (r *textReporter) ContentMismatch(relPath string) {
+	r.counts[KindContentMismatch]++
+	fmt.Fprintf(r.out, "content differs: %s\n", relPath)
+}
+
+func (r *textReporter) SyncSet(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncSet]++
+	if dryRun {
+		fmt.Fprintf(r.out, "would set %s: %s: %s\n", r.destDir, relPath, attr)
+		return
+	}
+	fmt.Fprintf(r.out, "set %s: %s: %s\n", r.destDir, relPath, attr)
+}
+
+func (r *textReporter) SyncRemove(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncRemove]++
+	if dryRun {
+		fmt.Fprintf(r.out, "would remove %s: %s: %s\n", r.destDir, relPath, attr)
+		return
+	}
+	fmt.Fprintf(r.out, "removed %s: %s: %s\n", r.destDir, relPath, attr)
+}
+
+func (r *textReporter) Summary() map[string]int {
+	return r.counts
+}
+
+// jsonReporter buffers every record and emits a single JSON array on Summary,
+// with the summary record appended last.
+type jsonReporter struct {
+	out     io.Writer
+	records []Record
+	counts  map[string]int
+}
+
+func (r *jsonReporter) OnlyIn(side Side, relPath string) {
+	kind := onlyInKind(side)
+	r.counts[kind]++
+	r.records = append(r.records, Record{Kind: kind, Path: relPath})
+}
+
+func (r *jsonReporter) XattrOnlyIn(side Side, relPath, attr string, value []byte) {
+	kind := xattrOnlyInKind(side)
+	r.counts[kind]++
+	rec := Record{Kind: kind, Path: relPath, Attr: attr}
+	if side == SideSrc {
+		rec.SrcValue = base64.StdEncoding.EncodeToString(value)
+	} else {
+		rec.DestValue = base64.StdEncoding.EncodeToString(value)
+	}
+	r.records = append(r.records, rec)
+}
+
+func (r *jsonReporter) XattrMismatch(relPath, attr string, srcValue, destValue []byte) {
+	r.counts[KindXattrMismatch]++
+	r.records = append(r.records, Record{
+		Kind:      KindXattrMismatch,
+		Path:      relPath,
+		Attr:      attr,
+		SrcValue:  base64.StdEncoding.EncodeToString(srcValue),
+		DestValue: base64.StdEncoding.EncodeToString(destValue),
+	})
+}
+
+func (r *jsonReporter) ContentMismatch(relPath string) {
+	r.counts[KindContentMismatch]++
+	r.records = append(r.records, Record{Kind: KindContentMismatch, Path: relPath})
+}
+
+func (r *jsonReporter) SyncSet(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncSet]++
+	r.records = append(r.records, Record{Kind: KindSyncSet, Path: relPath, Attr: attr, DryRun: dryRun})
+}
+
+func (r *jsonReporter) SyncRemove(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncRemove]++
+	r.records = append(r.records, Record{Kind: KindSyncRemove, Path: relPath, Attr: attr, DryRun: dryRun})
+}
+
+func (r *jsonReporter) Summary() map[string]int {
+	r.records = append(r.records, Record{Kind: KindSummary, Counts: r.counts})
+	enc := json.NewEncoder(r.out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.records); err != nil {
+		notifyError(err)
+	}
+	return r.counts
+}
+
+// ndjsonReporter writes one JSON record per line as results are found.
+type ndjsonReporter struct {
+	w      *bufio.Writer
+	counts map[string]int
+}
+
+func (r *ndjsonReporter) emit(rec Record) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		notifyError(err)
+		return
+	}
+	r.w.Write(data)
+	r.w.WriteByte('\n')
+}
+
+func (r *ndjsonReporter) OnlyIn(side Side, relPath string) {
+	kind := onlyInKind(side)
+	r.counts[kind]++
+	r.emit(Record{Kind: kind, Path: relPath})
+}
+
+func (r *ndjsonReporter) XattrOnlyIn(side Side, relPath, attr string, value []byte) {
+	kind := xattrOnlyInKind(side)
+	r.counts[kind]++
+	rec := Record{Kind: kind, Path: relPath, Attr: attr}
+	if side == SideSrc {
+		rec.SrcValue = base64.StdEncoding.EncodeToString(value)
+	} else {
+		rec.DestValue = base64.StdEncoding.EncodeToString(value)
+	}
+	r.emit(rec)
+}
+
+func (r *ndjsonReporter) XattrMismatch(relPath, attr string, srcValue, destValue []byte) {
+	r.counts[KindXattrMismatch]++
+	r.emit(Record{
+		Kind:      KindXattrMismatch,
+		Path:      relPath,
+		Attr:      attr,
+		SrcValue:  base64.StdEncoding.EncodeToString(srcValue),
+		DestValue: base64.StdEncoding.EncodeToString(destValue),
+	})
+}
+
+func (r *ndjsonReporter) ContentMismatch(relPath string) {
+	r.counts[KindContentMismatch]++
+	r.emit(Record{Kind: KindContentMismatch, Path: relPath})
+}
+
+func (r *ndjsonReporter) SyncSet(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncSet]++
+	r.emit(Record{Kind: KindSyncSet, Path: relPath, Attr: attr, DryRun: dryRun})
+}
+
+func (r *ndjsonReporter) SyncRemove(relPath, attr string, dryRun bool) {
+	r.counts[KindSyncRemove]++
+	r.emit(Record{Kind: KindSyncRemove, Path: relPath, Attr: attr, DryRun: dryRun})
+}
+
+func (r *ndjsonReporter) Summary() map[string]int {
+	r.emit(Record{Kind: KindSummary, Counts: r.counts})
+	r.w.Flush()
+	return r.counts
+}
+
+func onlyInKind(side Side) string {
+	if side == SideSrc {
+		return KindOnlyInSrc
+	}
+	return KindOnlyInDest
+}
+
+func xattrOnlyInKind(side Side) string {
+	if side == SideSrc {
+		return KindXattrOnlySrc
+	}
+	return KindXattrOnlyDest
+}
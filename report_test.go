@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewReporterUnknownFormat(t *testing.T) {
+	if _, err := newReporter("xml", &bytes.Buffer{}, "src", "dest"); err == nil {
+		t.Fatal("expected an error for an unrecognized format")
+	}
+}
+
+func TestTextReporterOutput(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := newReporter("text", &buf, "src", "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.OnlyIn(SideSrc, "a.txt")
+	r.XattrMismatch("b.txt", "user.tag", []byte("v1"), []byte("v2"))
+	r.SyncSet("b.txt", "user.tag", false)
+	counts := r.Summary()
+
+	want := "only in src: a.txt\nb.txt differ: user.tag\nset dest: b.txt: user.tag\n"
+	if buf.String() != want {
+		t.Fatalf("text output = %q, want %q", buf.String(), want)
+	}
+	if counts[KindOnlyInSrc] != 1 || counts[KindXattrMismatch] != 1 || counts[KindSyncSet] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestJSONReporterIsOneValidDocument(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := newReporter("json", &buf, "src", "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.OnlyIn(SideDest, "a.txt")
+	r.XattrOnlyIn(SideSrc, "b.txt", "user.tag", []byte("v1"))
+	r.SyncRemove("c.txt", "user.extra", true)
+	counts := r.Summary()
+
+	var records []Record
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("output is not a single valid JSON document: %v\n%s", err, buf.String())
+	}
+	if len(records) != 4 { // 3 events + trailing summary
+		t.Fatalf("got %d records, want 4: %+v", len(records), records)
+	}
+	if records[len(records)-1].Kind != KindSummary {
+		t.Fatalf("expected the last record to be the summary, got %q", records[len(records)-1].Kind)
+	}
+	if counts[KindOnlyInDest] != 1 || counts[KindXattrOnlySrc] != 1 || counts[KindSyncRemove] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestNDJSONReporterIsOneRecordPerLine(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := newReporter("ndjson", &buf, "src", "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ContentMismatch("a.bin")
+	r.SyncSet("a.bin", "user.tag", true)
+	r.Summary()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 { // 2 events + trailing summary
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line is not valid JSON: %v: %q", err, line)
+		}
+	}
+}
+
+func TestExitCodeReflectsCounts(t *testing.T) {
+	if got := exitCode(nil, nil, nil, 0, map[string]int{}); got != 0 {
+		t.Fatalf("exitCode with no differences = %d, want 0", got)
+	}
+	if got := exitCode(nil, nil, nil, 0, map[string]int{KindXattrMismatch: 1}); got != 1 {
+		t.Fatalf("exitCode with a difference = %d, want 1", got)
+	}
+	if got := exitCode(nil, nil, nil, 1, map[string]int{}); got != 2 {
+		t.Fatalf("exitCode with a scan error = %d, want 2", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pkg/xattr"
+)
+
+// Syncer applies src xattrs onto dest files for matched paths, turning
+// xattrdiff from a pure reporter into a reconciler. It's only driven from
+// the single compareEntries goroutine, so it doesn't need to be safe for
+// concurrent use.
+type Syncer struct {
+	DryRun bool
+	Delete bool
+	Only   []string
+}
+
+func (s *Syncer) allowed(name string) bool {
+	if len(s.Only) == 0 {
+		return true
+	}
+	for _, pattern := range s.Only {
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetXattr writes a src xattr onto destPath so it matches src. isSymlink
+// must match how destPath's xattrs were read (osFS.GetXattr's isSymlink),
+// so a symlink's own xattr is written onto the symlink rather than
+// whatever it points at. relPath identifies destPath for reporter, which
+// is told of the outcome instead of this printing directly, so --apply
+// stays machine-readable under --format json/ndjson.
+func (s *Syncer) SetXattr(destPath, relPath, name string, value []byte, isSymlink bool, reporter Reporter) {
+	if !s.allowed(name) {
+		return
+	}
+	if s.DryRun {
+		reporter.SyncSet(relPath, name, true)
+		return
+	}
+	var err error
+	if isSymlink {
+		err = xattr.LSet(destPath, name, value)
+	} else {
+		err = xattr.Set(destPath, name, value)
+	}
+	if err != nil {
+		notifyError(err)
+		return
+	}
+	reporter.SyncSet(relPath, name, false)
+}
+
+// RemoveXattr removes a dest xattr that doesn't exist in src, if --delete
+// was requested. See SetXattr for isSymlink and reporter.
+func (s *Syncer) RemoveXattr(destPath, relPath, name string, isSymlink bool, reporter Reporter) {
+	if !s.Delete || !s.allowed(name) {
+		return
+	}
+	if s.DryRun {
+		reporter.SyncRemove(relPath, name, true)
+		return
+	}
+	var err error
+	if isSymlink {
+		err = xattr.LRemove(destPath, name)
+	} else {
+		err = xattr.Remove(destPath, name)
+	}
+	if err != nil {
+		notifyError(err)
+		return
+	}
+	reporter.SyncRemove(relPath, name, false)
+}
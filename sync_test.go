@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/xattr"
+)
+
+// recordingReporter is a test double that records only the sync-related
+// calls Syncer makes; the rest are no-ops since Syncer never calls them.
+type recordingReporter struct {
+	sets    []string
+	removes []string
+}
+
+func (r *recordingReporter) OnlyIn(Side, string)                          {}
+func (r *recordingReporter) XattrOnlyIn(Side, string, string, []byte)     {}
+func (r *recordingReporter) XattrMismatch(string, string, []byte, []byte) {}
+func (r *recordingReporter) ContentMismatch(string)                       {}
+func (r *recordingReporter) Summary() map[string]int                      { return nil }
+func (r *recordingReporter) SyncSet(relPath, attr string, dryRun bool) {
+	r.sets = append(r.sets, relPath+":"+attr)
+}
+func (r *recordingReporter) SyncRemove(relPath, attr string, dryRun bool) {
+	r.removes = append(r.removes, relPath+":"+attr)
+}
+
+func TestSyncerSetXattrWritesAndReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{}
+	r := &recordingReporter{}
+	s.SetXattr(path, "f.txt", "user.tag", []byte("v1"), false, r)
+
+	got, err := xattr.Get(path, "user.tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v1" {
+		t.Fatalf("xattr value = %q, want %q", got, "v1")
+	}
+	if len(r.sets) != 1 || r.sets[0] != "f.txt:user.tag" {
+		t.Fatalf("reporter.sets = %v, want [f.txt:user.tag]", r.sets)
+	}
+}
+
+func TestSyncerDryRunDoesNotWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{DryRun: true}
+	r := &recordingReporter{}
+	s.SetXattr(path, "f.txt", "user.tag", []byte("v1"), false, r)
+
+	if _, err := xattr.Get(path, "user.tag"); err == nil {
+		t.Fatal("expected --dry-run not to write the xattr")
+	}
+	if len(r.sets) != 1 {
+		t.Fatalf("expected the reporter to still be told about the would-be set, got %v", r.sets)
+	}
+}
+
+func TestSyncerRemoveXattrRequiresDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := xattr.Set(path, "user.extra", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{}
+	r := &recordingReporter{}
+	s.RemoveXattr(path, "f.txt", "user.extra", false, r)
+
+	if _, err := xattr.Get(path, "user.extra"); err != nil {
+		t.Fatal("expected the xattr to survive when --delete wasn't requested")
+	}
+	if len(r.removes) != 0 {
+		t.Fatalf("expected no reporter call without --delete, got %v", r.removes)
+	}
+
+	s.Delete = true
+	s.RemoveXattr(path, "f.txt", "user.extra", false, r)
+	if _, err := xattr.Get(path, "user.extra"); err == nil {
+		t.Fatal("expected --delete to remove the xattr")
+	}
+	if len(r.removes) != 1 || r.removes[0] != "f.txt:user.extra" {
+		t.Fatalf("reporter.removes = %v, want [f.txt:user.extra]", r.removes)
+	}
+}
+
+func TestSyncerOnlyRestrictsAppliedXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{Only: []string{"user.keep*"}}
+	r := &recordingReporter{}
+	s.SetXattr(path, "f.txt", "user.keepme", []byte("v1"), false, r)
+	s.SetXattr(path, "f.txt", "user.other", []byte("v2"), false, r)
+
+	if _, err := xattr.Get(path, "user.keepme"); err != nil {
+		t.Fatal("expected user.keepme to be written, it matches --only")
+	}
+	if _, err := xattr.Get(path, "user.other"); err == nil {
+		t.Fatal("expected user.other not to be written, it doesn't match --only")
+	}
+	if len(r.sets) != 1 {
+		t.Fatalf("expected only one reported set, got %v", r.sets)
+	}
+}
+
+func TestSyncerSetXattrOnSymlinkWritesSymlinkNotTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// user.* xattrs aren't allowed directly on symlinks; trusted.* is, but
+	// needs CAP_SYS_ADMIN, so skip where that's unavailable.
+	if err := xattr.LSet(link, "trusted.tag", []byte("probe")); err != nil {
+		t.Skipf("cannot set trusted.* xattrs on a symlink here: %v", err)
+	}
+
+	s := &Syncer{}
+	r := &recordingReporter{}
+	s.SetXattr(link, "link.txt", "trusted.tag", []byte("on-link"), true, r)
+
+	got, err := xattr.LGet(link, "trusted.tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "on-link" {
+		t.Fatalf("symlink xattr = %q, want %q", got, "on-link")
+	}
+	if _, err := xattr.Get(target, "trusted.tag"); err == nil {
+		t.Fatal("expected the target to be untouched when isSymlink is true")
+	}
+}